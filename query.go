@@ -0,0 +1,798 @@
+// Copyright 2018 by caixw, All rights reserved.
+// Use of this source code is governed by a MIT
+// license that can be found in the LICENSE file.
+
+// Package query 用于将 HTTP 请求中的查询参数解析到结构体中。
+package query
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UnmarshalQuery 自定义查询参数的解析方式。
+//
+// 如果字段的类型实现了该接口，则 Parse 会优先调用该接口
+// 而不是根据字段的 reflect.Kind 进行转换。
+type UnmarshalQuery interface {
+	UnmarshalQuery(data string) error
+}
+
+// Sanitizer 用于在 Parse 转换完所有字段之后，对数据做二次较验。
+//
+// 如果 Parse 的目标对象实现了该接口，Parse 会在最后调用该接口，
+// 方便调用者对一些无法通过简单的类型转换处理的字段进行较验。
+type Sanitizer interface {
+	SanitizeQuery(errors map[string]string)
+}
+
+var unmarshalQueryType = reflect.TypeOf((*UnmarshalQuery)(nil)).Elem()
+
+// DecodeFunc 将字符串转换成对应类型的值。
+type DecodeFunc func(data string) (interface{}, error)
+
+var (
+	decodersMu sync.RWMutex
+	decoders   = map[reflect.Type]DecodeFunc{}
+)
+
+func init() {
+	RegisterDecoder(reflect.TypeOf(time.Duration(0)), func(data string) (interface{}, error) {
+		return time.ParseDuration(data)
+	})
+
+	RegisterDecoder(reflect.TypeOf(net.IP{}), func(data string) (interface{}, error) {
+		ip := net.ParseIP(data)
+		if ip == nil {
+			return nil, fmt.Errorf("无效的 IP 地址：%s", data)
+		}
+		return ip, nil
+	})
+
+	RegisterDecoder(reflect.TypeOf(&url.URL{}), func(data string) (interface{}, error) {
+		return url.Parse(data)
+	})
+}
+
+// RegisterDecoder 为类型 t 注册一个自定义的字符串解码函数。
+//
+// 当字段的类型未实现 UnmarshalQuery 接口时，Parse 会优先查找该类型
+// 是否注册了解码函数，如果有则调用该函数完成转换，否则再根据
+// reflect.Kind 做默认的类型转换。该机制主要用于无法实现 UnmarshalQuery
+// 接口的类型，比如标准库中的 time.Duration、net.IP。time.Time 由
+// Parse 内置支持，见 layout 标签选项。
+func RegisterDecoder(t reflect.Type, fn DecodeFunc) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+	decoders[t] = fn
+}
+
+// getDecoder 返回类型 t 已注册的解码函数。
+func getDecoder(t reflect.Type) (DecodeFunc, bool) {
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+	fn, ok := decoders[t]
+	return fn, ok
+}
+
+// ValidatorFunc 对字段的值进行较验。
+//
+// fv 是字段完成类型转换之后的值；raw 是用户通过查询参数提供的原始
+// 字符串，未提供时为空字符串（不会代入标签中的默认值），required 等
+// 与“是否提供”相关的规则应基于 raw 判断；arg 是标签选项中 "=" 右侧
+// 的参数，比如 min=1 中的 "1"，不带参数的规则（如 required）arg 为空。
+type ValidatorFunc func(fv reflect.Value, raw, arg string) error
+
+var (
+	validatorsMu sync.RWMutex
+	validators   = map[string]ValidatorFunc{}
+)
+
+func init() {
+	RegisterValidator("required", func(fv reflect.Value, raw, arg string) error {
+		if raw == "" {
+			return errors.New("不能为空")
+		}
+		return nil
+	})
+
+	RegisterValidator("min", func(fv reflect.Value, raw, arg string) error {
+		min, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return err
+		}
+		if raw != "" && numericValue(fv) < min {
+			return fmt.Errorf("不能小于 %s", arg)
+		}
+		return nil
+	})
+
+	RegisterValidator("max", func(fv reflect.Value, raw, arg string) error {
+		max, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return err
+		}
+		if raw != "" && numericValue(fv) > max {
+			return fmt.Errorf("不能大于 %s", arg)
+		}
+		return nil
+	})
+
+	RegisterValidator("enum", func(fv reflect.Value, raw, arg string) error {
+		if raw == "" {
+			return nil
+		}
+		for _, opt := range strings.Split(arg, "|") {
+			if opt == raw {
+				return nil
+			}
+		}
+		return fmt.Errorf("取值只能是以下之一：%s", arg)
+	})
+
+	RegisterValidator("regex", regexValidator)
+}
+
+// regexValidator 是内置的 "regex" 较验规则的实现，以具名函数的形式
+// 存在，以便 buildValidators 可以通过函数指针识别出 "regex" 选项
+// 当前引用的确实是这个内置实现，而不是调用方通过 RegisterValidator
+// 覆盖注册的同名规则，从而决定是否可以安全地走预编译的快速路径。
+func regexValidator(fv reflect.Value, raw, arg string) error {
+	re, err := regexp.Compile(arg)
+	if err != nil {
+		return err
+	}
+	return regexMatch(re, raw)
+}
+
+// RegisterValidator 以 name 注册一个较验规则。
+//
+// 注册之后即可在 query 标签的选项中以 name 或 name=arg 的形式引用，
+// 例如注册了 "min" 后，便可以使用 `query:"page,1,min=1"`。Parse 会在
+// 字段完成类型转换之后依次执行其配置的较验规则，并将第一个失败的
+// 规则返回的 error 写入 errors，因此 name 不应与 sep、repeat、layout、
+// prefix 等既有标签选项重名。
+func RegisterValidator(name string, fn ValidatorFunc) {
+	validatorsMu.Lock()
+	defer validatorsMu.Unlock()
+	validators[name] = fn
+}
+
+// getValidator 返回 name 对应的较验规则。
+func getValidator(name string) (ValidatorFunc, bool) {
+	validatorsMu.RLock()
+	defer validatorsMu.RUnlock()
+	fn, ok := validators[name]
+	return fn, ok
+}
+
+// regexMatch 使用预编译的正则表达式 re 对 raw 进行匹配，未提供 raw
+// 时视为通过。RegisterValidator("regex", ...) 的默认实现与
+// buildValidators 预编译 regex 规则时共用该逻辑。
+func regexMatch(re *regexp.Regexp, raw string) error {
+	if raw == "" {
+		return nil
+	}
+	if !re.MatchString(raw) {
+		return errors.New("格式不正确")
+	}
+	return nil
+}
+
+// numericValue 返回 fv 的数值表示，供 min、max 等数值类规则使用，
+// 不支持的类型返回 0。
+func numericValue(fv reflect.Value) float64 {
+	switch fv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(fv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(fv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return fv.Float()
+	case reflect.Ptr:
+		if fv.IsNil() {
+			return 0
+		}
+		return numericValue(fv.Elem())
+	default:
+		return 0
+	}
+}
+
+// timeType 是 time.Time 的反射类型，Parse 对其做了内置的特殊处理，
+// 以便支持 layout 标签选项。
+var timeType = reflect.TypeOf(time.Time{})
+
+// valueSpec 描述了如何将字符串转换成某一类型的值，fieldInfo 中的
+// 标量字段与切片字段共用该结构，切片的元素类型通过 elem 表示。
+type valueSpec struct {
+	kind        reflect.Kind
+	unmarshaler bool       // 是否实现了 UnmarshalQuery
+	decode      DecodeFunc // 通过 RegisterDecoder 注册的解码函数
+	isTime      bool       // 是否为 time.Time
+	layout      string     // isTime 为 true 时，解析所使用的时间格式
+	elem        *valueSpec // kind 为 Slice 或 Ptr 时，其元素/指向类型的 valueSpec
+}
+
+// buildValueSpec 根据类型 t 及标签选项 opts 构建其 valueSpec。
+func buildValueSpec(t reflect.Type, opts []string) valueSpec {
+	vs := valueSpec{kind: t.Kind()}
+
+	// 指针字段本身不参与类型转换，真正的转换通常发生在其指向的元素上，
+	// 但像 *url.URL 这样的指针类型可能直接通过 RegisterDecoder 或
+	// UnmarshalQuery 注册在指针类型本身之上，此时应优先使用指针类型
+	// 自身的解码方式，而不是将其解包成元素类型（*url.URL 解包后的
+	// url.URL 并未注册任何解码方式，会退化到不支持的 struct 类型）。
+	if vs.kind == reflect.Ptr {
+		if t.Implements(unmarshalQueryType) {
+			vs.unmarshaler = true
+			return vs
+		}
+		if fn, ok := getDecoder(t); ok {
+			vs.decode = fn
+			return vs
+		}
+
+		elem := buildValueSpec(t.Elem(), opts)
+		vs.elem = &elem
+		return vs
+	}
+
+	vs.unmarshaler = reflect.PtrTo(t).Implements(unmarshalQueryType)
+
+	if t == timeType {
+		vs.isTime = true
+		vs.layout = time.RFC3339
+		if layout, ok := getOption(opts, "layout"); ok {
+			vs.layout = layout
+		}
+	} else if fn, ok := getDecoder(t); ok {
+		vs.decode = fn
+	}
+
+	if vs.kind == reflect.Slice {
+		elem := buildValueSpec(t.Elem(), opts)
+		vs.elem = &elem
+	}
+
+	return vs
+}
+
+// validatorRef 是标签中一条较验规则的引用：fn 为规则本身，arg 为
+// 规则携带的参数（如 min=1 中的 "1"）。regex 用于内置的 regex 规则：
+// buildValidators 在构建标签时预编译一次 arg，避免 Parse 在每次请求
+// 时都重新编译同一个正则表达式；regex 为 nil 时按 fn/arg 正常执行。
+type validatorRef struct {
+	fn    ValidatorFunc
+	arg   string
+	regex *regexp.Regexp
+}
+
+// fieldInfo 是对结构体中一个字段的 query 标签及类型信息的预计算结果，
+// 由 getTypeInfo 构建并缓存，避免 Parse 在每次请求时重复反射分析。
+type fieldInfo struct {
+	index      int
+	name       string
+	defaults   []string // 预先按 sep 切分的默认值，标量字段在使用时再 Join 还原
+	sep        string   // 切片字段的分隔符，默认为","，可通过 sep= 选项指定
+	repeat     bool     // 切片字段是否使用 ?a=1&a=2 的重复参数形式
+	kind       reflect.Kind
+	anonymous  bool // 是否为匿名的结构体字段，需要展开处理
+	prefix     bool // 是否为带 prefix 选项的嵌套结构体字段
+	isMap      bool // 是否为 map[string]string 或 map[string][]string 字段
+	value      valueSpec
+	validators []validatorRef // 标签中配置的较验规则，按声明顺序依次执行
+}
+
+// typeInfo 缓存了某一结构体类型中所有可解析字段的 fieldInfo。
+type typeInfo struct {
+	fields []fieldInfo
+}
+
+// typeInfoCache 以 reflect.Type 为键缓存每个结构体类型的 typeInfo，
+// 在并发的 HTTP 请求下无需加锁即可安全读写。
+var typeInfoCache sync.Map
+
+// getTypeInfo 返回 t 对应的 typeInfo，如果是第一次访问该类型，
+// 则构建并缓存该类型的字段信息。
+func getTypeInfo(t reflect.Type) *typeInfo {
+	if cached, ok := typeInfoCache.Load(t); ok {
+		return cached.(*typeInfo)
+	}
+
+	info := buildTypeInfo(t)
+	actual, _ := typeInfoCache.LoadOrStore(t, info)
+	return actual.(*typeInfo)
+}
+
+// buildTypeInfo 遍历 t 的所有字段，构建其 typeInfo。
+func buildTypeInfo(t reflect.Type) *typeInfo {
+	info := &typeInfo{fields: make([]fieldInfo, 0, t.NumField())}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fi := fieldInfo{index: i, kind: field.Type.Kind()}
+
+		// 匿名结构体字段（如内嵌的 testQueryString）需要先于 PkgPath
+		// 判断处理：其类型名即便是未导出的，字段本身依然会被展开，
+		// field.PkgPath 此时反映的是类型名的可见性而非字段是否可用。
+		if field.Anonymous && fi.kind == reflect.Struct {
+			fi.anonymous = true
+			info.fields = append(info.fields, fi)
+			continue
+		}
+
+		if field.PkgPath != "" { // 不导出的字段
+			continue
+		}
+
+		if field.Tag.Get("query") == "-" { // 忽略的字段
+			continue
+		}
+
+		name, def, opts := splitTag(field.Tag.Get("query"))
+		fi.name = name
+
+		switch {
+		case fi.kind == reflect.Struct && hasOption(opts, "prefix"):
+			fi.prefix = true
+		case fi.kind == reflect.Map:
+			fi.isMap = true
+		default:
+			fi.sep = ","
+			if sep, ok := getOption(opts, "sep"); ok && sep != "" {
+				fi.sep = sep
+			}
+			fi.repeat = hasOption(opts, "repeat")
+			fi.value = buildValueSpec(field.Type, opts)
+			fi.validators = buildValidators(opts)
+
+			if def != "" {
+				fi.defaults = strings.Split(def, fi.sep)
+			}
+		}
+
+		info.fields = append(info.fields, fi)
+	}
+
+	return info
+}
+
+// Parse 将 r 中的查询参数解析到 v 指向的对象中。
+//
+// v 必须是一个指向结构体的指针，否则将 panic。
+// 字段完成类型转换之后，Parse 还会依次执行标签中配置的较验规则
+// （如 query:"page,1,min=1,max=100"），失败的规则也会写入返回值，
+// 这样大部分简单的手写较验都可以省去，只在 Sanitizer 中处理剩余的、
+// 需要结合多个字段才能判断的较验逻辑。
+// 返回值以字段的 query 名称作为键名，對应的错误信息作为键值，
+// 如果没有发生任何错误，则返回一个空的 map。
+func Parse(r *http.Request, v interface{}) map[string]string {
+	val := reflect.ValueOf(v)
+	if val.Kind() != reflect.Ptr || val.Elem().Kind() != reflect.Struct {
+		panic("v 必须是一个指向结构体的指针")
+	}
+
+	errors := make(map[string]string, 10)
+
+	parseField(r, val.Elem(), errors)
+
+	if s, ok := v.(Sanitizer); ok {
+		s.SanitizeQuery(errors)
+	}
+
+	return errors
+}
+
+// parseField 将 r 中的查询参数解析到 val 表示的结构体中。
+//
+// val 中的匿名结构体字段会被展开处理，其字段与外层字段一样对待；
+// 标签为 `query:"prefix.,prefix"` 的具名结构体字段，则会以 prefix. 为
+// 前缀递归处理其子字段；map[string]string 或 map[string][]string 类型
+// 的字段，则会收集所有未被其它字段占用的查询参数，若标签中指定了
+// 名称（如 `query:"filters."`），还会以该名称为前缀限定收集范围。
+func parseField(r *http.Request, val reflect.Value, errors map[string]string) {
+	parseFieldPrefix(r, val, "", map[string]bool{}, errors)
+}
+
+// parseFieldPrefix 是 parseField 的实际实现。
+//
+// prefix 为当前层级的查询参数前缀，consumed 记录已经被具名字段占用的
+// 查询参数名称，以便 map 字段在收集剩余参数时将其排除在外。
+func parseFieldPrefix(r *http.Request, val reflect.Value, prefix string, consumed map[string]bool, errors map[string]string) {
+	query := r.URL.Query()
+	info := getTypeInfo(val.Type())
+	mapFields := make([]fieldInfo, 0, 1)
+
+	for _, fi := range info.fields {
+		fv := val.Field(fi.index)
+
+		if fi.anonymous {
+			parseFieldPrefix(r, fv, prefix, consumed, errors)
+			continue
+		}
+
+		if fi.prefix {
+			parseFieldPrefix(r, fv, prefix+fi.name, consumed, errors)
+			continue
+		}
+
+		if fi.isMap {
+			mapFields = append(mapFields, fi)
+			continue
+		}
+
+		if fi.name == "" {
+			continue
+		}
+		name := prefix + fi.name
+		consumed[name] = true
+		parseSingleField(query, fv, fi, name, errors)
+	}
+
+	for _, fi := range mapFields {
+		// map 字段自身的标签名称（如 query:"filters."）会拼接在当前
+		// 层级的 prefix 之后，与嵌套结构体的 prefix 选项一样充当
+		// parseMap 收集参数时的前缀，不再是被解析却从未使用的死值。
+		parseMap(query, val.Field(fi.index), prefix+fi.name, consumed, errors)
+	}
+}
+
+// parseSingleField 解析具名字段 fi 对应的查询参数，并在类型转换
+// 成功后依次执行该字段配置的较验规则。
+func parseSingleField(query url.Values, fv reflect.Value, fi fieldInfo, name string, errors map[string]string) {
+	userRaw := query.Get(name)
+
+	// fi.value.decode 不为空表示该切片类型（如 net.IP）本身就有专属的
+	// 解码方式，不应被当作逗号/repeat 风格的元素列表来拆分。
+	if fi.kind == reflect.Slice && fi.value.decode == nil {
+		if values, ok := query[name]; ok && (fi.repeat || len(values) > 1) {
+			if err := setSlice(fv, values, *fi.value.elem); err != nil {
+				errors[name] = err.Error()
+				return
+			}
+			runValidators(fv, fi, userRaw, name, errors)
+			return
+		}
+	}
+
+	raw := userRaw
+	if raw == "" {
+		if !fv.IsZero() {
+			runValidators(fv, fi, userRaw, name, errors)
+			return
+		}
+
+		if len(fi.defaults) != 0 {
+			raw = strings.Join(fi.defaults, fi.sep)
+		}
+	}
+
+	if raw != "" {
+		if err := setValue(fv, raw, fi.sep, fi.value); err != nil {
+			errors[name] = err.Error()
+			return
+		}
+	}
+
+	runValidators(fv, fi, userRaw, name, errors)
+}
+
+// runValidators 依次执行 fi 配置的较验规则，userRaw 是用户提供的
+// 原始查询参数值（不含标签默认值，未提供时为空字符串），一旦某条
+// 规则失败便写入 errors 并停止后续规则的执行。
+func runValidators(fv reflect.Value, fi fieldInfo, userRaw, name string, errors map[string]string) {
+	for _, v := range fi.validators {
+		var err error
+		if v.regex != nil { // 预编译的 regex 规则，跳过 v.fn 中的重复编译
+			err = regexMatch(v.regex, userRaw)
+		} else {
+			err = v.fn(fv, userRaw, v.arg)
+		}
+		if err != nil {
+			errors[name] = err.Error()
+			return
+		}
+	}
+}
+
+// parseMap 将 query 中未被其它字段占用的参数写入 fv 表示的
+// map[string]string 或 map[string][]string 字段中。
+//
+// prefix 不为空时，只收集以 prefix 为前缀的参数，并去除该前缀；
+// consumed 中记录的参数名称已被其它具名字段占用，不会被收集。
+func parseMap(query url.Values, fv reflect.Value, prefix string, consumed map[string]bool, errors map[string]string) {
+	t := fv.Type()
+	if t.Key().Kind() != reflect.String {
+		return
+	}
+
+	elem := t.Elem()
+	isSlice := elem.Kind() == reflect.Slice && elem.Elem().Kind() == reflect.String
+	if elem.Kind() != reflect.String && !isSlice {
+		return
+	}
+
+	m := reflect.MakeMapWithSize(t, len(query))
+	for key, values := range query {
+		if consumed[key] {
+			continue
+		}
+
+		name := key
+		if prefix != "" {
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			name = strings.TrimPrefix(key, prefix)
+		}
+
+		if isSlice {
+			m.SetMapIndex(reflect.ValueOf(name), reflect.ValueOf(values))
+		} else {
+			m.SetMapIndex(reflect.ValueOf(name), reflect.ValueOf(values[0]))
+		}
+	}
+
+	if m.Len() > 0 {
+		fv.Set(m)
+	}
+}
+
+// setValue 将字符串 raw 转换成 fv 对应的类型，并写入 fv。
+//
+// sep 是切片字段按分隔符切分 raw 时使用的分隔符（参见 sep= 标签选项），
+// vs 是 fv 对应的 valueSpec，由 fieldInfo 预先计算得出。
+func setValue(fv reflect.Value, raw string, sep string, vs valueSpec) error {
+	// 指针字段：分配一个新的元素，将值解析到该元素之后再让 fv 指向它。
+	// 只有在转换成功之后才会给 fv 赋值，因此字段只有在查询参数被提供
+	// （或使用了标签中的默认值）且转换成功时才会变为非 nil，未提供且
+	// 没有默认值时保持 nil，以此区分“未提供”与“零值”。
+	if vs.kind == reflect.Ptr {
+		// 指针类型本身就注册了 UnmarshalQuery 或 RegisterDecoder（如
+		// *url.URL），此时应直接使用该方式解析，而不是递归处理其
+		// 指向的元素（vs.elem 在这两种情况下为 nil）。
+		if vs.unmarshaler {
+			ptr := reflect.New(fv.Type().Elem())
+			if err := ptr.Interface().(UnmarshalQuery).UnmarshalQuery(raw); err != nil {
+				return err
+			}
+			fv.Set(ptr)
+			return nil
+		}
+
+		if vs.decode != nil {
+			decoded, err := vs.decode(raw)
+			if err != nil {
+				return err
+			}
+
+			dv := reflect.ValueOf(decoded)
+			if !dv.Type().AssignableTo(fv.Type()) {
+				return fmt.Errorf("解码得到的类型 %s 无法赋值给字段类型 %s", dv.Type(), fv.Type())
+			}
+			fv.Set(dv)
+			return nil
+		}
+
+		ptr := reflect.New(fv.Type().Elem())
+		if err := setValue(ptr.Elem(), raw, sep, *vs.elem); err != nil {
+			return err
+		}
+		fv.Set(ptr)
+		return nil
+	}
+
+	if vs.unmarshaler && fv.CanAddr() {
+		return fv.Addr().Interface().(UnmarshalQuery).UnmarshalQuery(raw)
+	}
+
+	if vs.isTime {
+		tm, err := time.Parse(vs.layout, raw)
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(tm))
+		return nil
+	}
+
+	if vs.decode != nil {
+		decoded, err := vs.decode(raw)
+		if err != nil {
+			return err
+		}
+
+		dv := reflect.ValueOf(decoded)
+		if !dv.Type().AssignableTo(fv.Type()) {
+			return fmt.Errorf("解码得到的类型 %s 无法赋值给字段类型 %s", dv.Type(), fv.Type())
+		}
+		fv.Set(dv)
+		return nil
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(raw)
+	case reflect.Slice:
+		return setSlice(fv, strings.Split(raw, sep), *vs.elem)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	default:
+		return fmt.Errorf("不支持的类型：%s", fv.Kind())
+	}
+
+	return nil
+}
+
+// setSlice 依次将 items 中的每个元素转换后追加到 fv 表示的切片中。
+//
+// 一旦某个元素转换失败，fv 会被设置为已经成功转换的部分，并返回该错误，
+// 调用方可以据此判断该字段是否完整解析。
+func setSlice(fv reflect.Value, items []string, elemSpec valueSpec) error {
+	slice := reflect.MakeSlice(fv.Type(), 0, len(items))
+	for _, item := range items {
+		elem := reflect.New(fv.Type().Elem()).Elem()
+		if err := setValue(elem, item, ",", elemSpec); err != nil {
+			fv.Set(slice)
+			return err
+		}
+		slice = reflect.Append(slice, elem)
+	}
+	fv.Set(slice)
+
+	return nil
+}
+
+// bareTagOptions 是标签第三段中无需 "=" 的布尔型选项。
+var bareTagOptions = map[string]bool{
+	"prefix":   true,
+	"repeat":   true,
+	"required": true,
+}
+
+// isTagOption 判断 s 是否是 query 标签中第三段的选项写法，
+// 即 key=value 形式，或者是 bareTagOptions 中预定义的布尔选项，
+// 又或是通过 RegisterValidator 注册的、不带参数的较验规则名称
+// （例如 query:"page,1,even"）。后一种情况需要查询较验规则的
+// 注册表，而不能像 bareTagOptions 那样固定一份名单，否则调用方
+// 通过 RegisterValidator 注册的无参规则会被当成默认值的一部分。
+func isTagOption(s string) bool {
+	if strings.ContainsRune(s, '=') {
+		return true
+	}
+	if bareTagOptions[s] {
+		return true
+	}
+	_, ok := getValidator(s)
+	return ok
+}
+
+// splitTag 将 query 标签切分成名称、默认值以及选项列表。
+//
+// 标签格式为 `query:"name,default,opt1,opt2"`，选项只能出现在标签的
+// 末尾：从右往左扫描，一旦遇到无法识别的选项写法，便认为其左侧（含
+// 该部分）都属于默认值，从而保证默认值本身可以包含逗号，兼容形如
+// `query:"floats,1.1,2.2"` 的历史写法。
+func splitTag(tag string) (name, def string, opts []string) {
+	if tag == "" || tag == "-" {
+		return "", "", nil
+	}
+
+	parts := strings.Split(tag, ",")
+	name = parts[0]
+	rest := parts[1:]
+
+	end := len(rest)
+	for end > 0 && isTagOption(rest[end-1]) {
+		end--
+	}
+	opts = rest[end:]
+	def = strings.Join(rest[:end], ",")
+
+	return name, def, opts
+}
+
+// hasOption 判断 opts 中是否包含 name 对应的布尔选项。
+func hasOption(opts []string, name string) bool {
+	for _, o := range opts {
+		if o == name {
+			return true
+		}
+	}
+	return false
+}
+
+// getOption 返回 opts 中 key=value 形式选项的值。
+func getOption(opts []string, key string) (string, bool) {
+	p := key + "="
+	for _, o := range opts {
+		if strings.HasPrefix(o, p) {
+			return strings.TrimPrefix(o, p), true
+		}
+	}
+	return "", false
+}
+
+// nonValidatorOptions 是 opts 中已有其它专属含义、不应被当作较验
+// 规则名称处理的选项。
+var nonValidatorOptions = map[string]bool{
+	"sep":    true,
+	"repeat": true,
+	"layout": true,
+	"prefix": true,
+}
+
+// buildValidators 从 opts 中挑出已通过 RegisterValidator 注册的规则，
+// 按标签中出现的顺序构建其 validatorRef 列表。
+func buildValidators(opts []string) []validatorRef {
+	var vs []validatorRef
+	for _, o := range opts {
+		key := o
+		arg := ""
+		if i := strings.IndexByte(o, '='); i >= 0 {
+			key, arg = o[:i], o[i+1:]
+		}
+
+		if nonValidatorOptions[key] {
+			continue
+		}
+
+		fn, ok := getValidator(key)
+		if !ok {
+			continue
+		}
+
+		ref := validatorRef{fn: fn, arg: arg}
+		// 只有在 fn 确实是内置的 regexValidator 时才预编译正则表达式：
+		// key == "regex" 只能说明标签用了 "regex" 这个名字，调用方完全
+		// 可能通过 RegisterValidator("regex", ...) 换成了别的实现，此时
+		// 仍应走下面 runValidators 中 v.fn 的通用调用路径。
+		if reflect.ValueOf(fn).Pointer() == reflect.ValueOf(regexValidator).Pointer() {
+			if re, err := regexp.Compile(arg); err == nil {
+				ref.regex = re
+			}
+		}
+		vs = append(vs, ref)
+	}
+	return vs
+}
+
+// getQueryTag 分析 field 中 query 标签的内容，返回参数名称以及默认值。
+//
+// 标签内容的格式为 `query:"name,default"`，如果将名称设置为 -，
+// 表示忽略该字段。
+func getQueryTag(field reflect.StructField) (name, def string) {
+	name, def, _ = splitTag(field.Tag.Get("query"))
+	return name, def
+}
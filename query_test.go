@@ -5,11 +5,15 @@
 package query
 
 import (
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/issue9/assert"
 )
@@ -169,3 +173,324 @@ func TestGetQueryTag(t *testing.T) {
 	test(`query:"name,1,2,"`, "name", "1,2,")
 	test(`query:"-"`, "", "")
 }
+
+type testNestedUser struct {
+	Name string `query:"name"`
+	Age  int    `query:"age,18"`
+}
+
+type testNestedObject struct {
+	User    testNestedUser    `query:"user.,prefix"`
+	Filters map[string]string `query:"filters."`
+}
+
+func TestParseField_nested(t *testing.T) {
+	a := assert.New(t)
+
+	errors := map[string]string{}
+	r := httptest.NewRequest(http.MethodGet, "/q?user.name=foo&user.age=30&filters.x=1&filters.y=2", nil)
+	data := &testNestedObject{}
+	parseField(r, reflect.ValueOf(data).Elem(), errors)
+	a.Empty(errors)
+	a.Equal(data.User.Name, "foo").
+		Equal(data.User.Age, 30).
+		Equal(data.Filters, map[string]string{"x": "1", "y": "2"})
+
+	// 未指定的嵌套字段使用标签中的默认值
+	errors = map[string]string{}
+	r = httptest.NewRequest(http.MethodGet, "/q?user.name=foo", nil)
+	data = &testNestedObject{}
+	parseField(r, reflect.ValueOf(data).Elem(), errors)
+	a.Empty(errors)
+	a.Equal(data.User.Age, 18)
+}
+
+type testUnnamedMap struct {
+	Filters map[string]string `query:""`
+}
+
+func TestParseField_unnamedMap(t *testing.T) {
+	a := assert.New(t)
+
+	// 未在标签中指定名称的 map 字段，收集所有未被其它字段占用的查询参数
+	errors := map[string]string{}
+	r := httptest.NewRequest(http.MethodGet, "/q?x=1&y=2", nil)
+	data := &testUnnamedMap{}
+	parseField(r, reflect.ValueOf(data).Elem(), errors)
+	a.Empty(errors)
+	a.Equal(data.Filters, map[string]string{"x": "1", "y": "2"})
+}
+
+type testSliceModes struct {
+	Pipes  []float64 `query:"pipes,1.1|2.2,sep=|"`
+	Repeat []string  `query:"repeat,,repeat"`
+}
+
+func TestParseField_sliceModes(t *testing.T) {
+	a := assert.New(t)
+
+	// sep= 指定了自定义分隔符
+	errors := map[string]string{}
+	r := httptest.NewRequest(http.MethodGet, "/q?pipes=3.3|4.4", nil)
+	data := &testSliceModes{}
+	parseField(r, reflect.ValueOf(data).Elem(), errors)
+	a.Empty(errors)
+	a.Equal(data.Pipes, []float64{3.3, 4.4})
+
+	// 未提供时使用标签中以 sep 切分的默认值
+	errors = map[string]string{}
+	r = httptest.NewRequest(http.MethodGet, "/q", nil)
+	data = &testSliceModes{}
+	parseField(r, reflect.ValueOf(data).Elem(), errors)
+	a.Empty(errors)
+	a.Equal(data.Pipes, []float64{1.1, 2.2})
+
+	// repeat 模式下接受 ?repeat=a&repeat=b 的重复参数形式
+	errors = map[string]string{}
+	r = httptest.NewRequest(http.MethodGet, "/q?repeat=a&repeat=b", nil)
+	data = &testSliceModes{}
+	parseField(r, reflect.ValueOf(data).Elem(), errors)
+	a.Empty(errors)
+	a.Equal(data.Repeat, []string{"a", "b"})
+
+	// 未标记 repeat 的切片字段，多个同名参数也会被自动识别
+	errors = map[string]string{}
+	r = httptest.NewRequest(http.MethodGet, "/q?pipes=1.1&pipes=2.2", nil)
+	data = &testSliceModes{}
+	parseField(r, reflect.ValueOf(data).Elem(), errors)
+	a.Empty(errors)
+	a.Equal(data.Pipes, []float64{1.1, 2.2})
+}
+
+type testDecoders struct {
+	From     time.Time     `query:"from"`
+	Birthday time.Time     `query:"birthday,,layout=2006-01-02"`
+	TTL      time.Duration `query:"ttl,1s"`
+	IP       net.IP        `query:"ip"`
+	Callback *url.URL      `query:"callback"`
+}
+
+func TestParseField_decoders(t *testing.T) {
+	a := assert.New(t)
+
+	errors := map[string]string{}
+	r := httptest.NewRequest(http.MethodGet, "/q?from=2019-01-02T15:04:05Z&birthday=2019-01-02&ttl=5s&ip=192.168.1.1&callback=https://example.com/path", nil)
+	data := &testDecoders{}
+	parseField(r, reflect.ValueOf(data).Elem(), errors)
+	a.Empty(errors)
+
+	from, err := time.Parse(time.RFC3339, "2019-01-02T15:04:05Z")
+	a.NotError(err)
+	a.True(data.From.Equal(from))
+
+	birthday, err := time.Parse("2006-01-02", "2019-01-02")
+	a.NotError(err)
+	a.True(data.Birthday.Equal(birthday))
+
+	a.Equal(data.TTL, 5*time.Second).
+		Equal(data.IP.String(), "192.168.1.1").
+		NotNil(data.Callback).
+		Equal(data.Callback.Host, "example.com")
+
+	// 未提供 ttl 时，使用默认值
+	errors = map[string]string{}
+	r = httptest.NewRequest(http.MethodGet, "/q?from=2019-01-02T15:04:05Z&birthday=2019-01-02&ip=192.168.1.1&callback=https://example.com/path", nil)
+	data = &testDecoders{}
+	parseField(r, reflect.ValueOf(data).Elem(), errors)
+	a.Empty(errors)
+	a.Equal(data.TTL, time.Second)
+}
+
+type testValidators struct {
+	Page  int    `query:"page,1,min=1,max=100"`
+	Email string `query:"email,,required,regex=^.+@.+$"`
+	State string `query:"state,normal,enum=normal|locked|left"`
+}
+
+func TestParseField_validators(t *testing.T) {
+	a := assert.New(t)
+
+	// 全部符合规则
+	errors := map[string]string{}
+	r := httptest.NewRequest(http.MethodGet, "/q?page=10&email=a@example.com&state=locked", nil)
+	data := &testValidators{}
+	parseField(r, reflect.ValueOf(data).Elem(), errors)
+	a.Empty(errors)
+	a.Equal(data.Page, 10).
+		Equal(data.Email, "a@example.com").
+		Equal(data.State, "locked")
+
+	// min、max 校验失败
+	errors = map[string]string{}
+	r = httptest.NewRequest(http.MethodGet, "/q?page=0&email=a@example.com", nil)
+	data = &testValidators{}
+	parseField(r, reflect.ValueOf(data).Elem(), errors)
+	a.True(errors["page"] != "")
+
+	errors = map[string]string{}
+	r = httptest.NewRequest(http.MethodGet, "/q?page=101&email=a@example.com", nil)
+	data = &testValidators{}
+	parseField(r, reflect.ValueOf(data).Elem(), errors)
+	a.True(errors["page"] != "")
+
+	// required 校验失败：未提供 email
+	errors = map[string]string{}
+	r = httptest.NewRequest(http.MethodGet, "/q?page=5", nil)
+	data = &testValidators{}
+	parseField(r, reflect.ValueOf(data).Elem(), errors)
+	a.True(errors["email"] != "")
+
+	// regex 校验失败
+	errors = map[string]string{}
+	r = httptest.NewRequest(http.MethodGet, "/q?page=5&email=invalid", nil)
+	data = &testValidators{}
+	parseField(r, reflect.ValueOf(data).Elem(), errors)
+	a.True(errors["email"] != "")
+
+	// enum 校验失败
+	errors = map[string]string{}
+	r = httptest.NewRequest(http.MethodGet, "/q?page=5&email=a@example.com&state=banned", nil)
+	data = &testValidators{}
+	parseField(r, reflect.ValueOf(data).Elem(), errors)
+	a.True(errors["state"] != "")
+}
+
+type testRegexOverride struct {
+	Code string `query:"code,,regex=ignored"`
+}
+
+func TestParseField_regexOverride(t *testing.T) {
+	a := assert.New(t)
+
+	// 覆盖注册 "regex"，确认 buildValidators 的预编译快速路径不会
+	// 绕过调用方的实现，而是始终通过 v.fn 执行真正注册的规则。
+	RegisterValidator("regex", func(fv reflect.Value, raw, arg string) error {
+		if raw != "ok" {
+			return errors.New("只能是 ok")
+		}
+		return nil
+	})
+	defer RegisterValidator("regex", regexValidator)
+
+	errs := map[string]string{}
+	r := httptest.NewRequest(http.MethodGet, "/q?code=ok", nil)
+	data := &testRegexOverride{}
+	parseField(r, reflect.ValueOf(data).Elem(), errs)
+	a.Empty(errs)
+
+	errs = map[string]string{}
+	r = httptest.NewRequest(http.MethodGet, "/q?code=anything-else", nil)
+	data = &testRegexOverride{}
+	parseField(r, reflect.ValueOf(data).Elem(), errs)
+	a.True(errs["code"] != "")
+}
+
+type testBareValidator struct {
+	Count int `query:"count,0,even"`
+}
+
+func TestParseField_bareCustomValidator(t *testing.T) {
+	a := assert.New(t)
+
+	// 注册一个无需 "=" 参数的自定义较验规则，确认它会被识别为标签
+	// 选项，而不是被当成默认值的一部分拼接到 "0" 后面。
+	RegisterValidator("even", func(fv reflect.Value, raw, arg string) error {
+		if raw == "" {
+			return nil
+		}
+		if fv.Int()%2 != 0 {
+			return errors.New("必须是偶数")
+		}
+		return nil
+	})
+
+	errs := map[string]string{}
+	r := httptest.NewRequest(http.MethodGet, "/q?count=4", nil)
+	data := &testBareValidator{}
+	parseField(r, reflect.ValueOf(data).Elem(), errs)
+	a.Empty(errs)
+	a.Equal(data.Count, 4)
+
+	errs = map[string]string{}
+	r = httptest.NewRequest(http.MethodGet, "/q?count=3", nil)
+	data = &testBareValidator{}
+	parseField(r, reflect.ValueOf(data).Elem(), errs)
+	a.True(errs["count"] != "")
+}
+
+type testPointers struct {
+	Count  *int       `query:"count"`
+	State  *State     `query:"state"`
+	Expire *time.Time `query:"expire"`
+	States []*State   `query:"states"`
+}
+
+func (obj *testPointers) SanitizeQuery(errors map[string]string) {
+	if obj.Count == nil {
+		errors["count"] = "count 未提供"
+	}
+}
+
+func TestParseField_pointers(t *testing.T) {
+	a := assert.New(t)
+
+	// 未提供任何参数时，指针字段保持 nil，以区别于“提供了零值”
+	errors := map[string]string{}
+	r := httptest.NewRequest(http.MethodGet, "/q", nil)
+	data := &testPointers{}
+	parseField(r, reflect.ValueOf(data).Elem(), errors)
+	a.Empty(errors)
+	a.Nil(data.Count).
+		Nil(data.State).
+		Nil(data.Expire).
+		Nil(data.States)
+
+	// 提供参数后分配指针并解析其指向的值
+	errors = map[string]string{}
+	r = httptest.NewRequest(http.MethodGet, "/q?count=5&state=locked&expire=2019-01-02T15:04:05Z&states=normal&states=left", nil)
+	data = &testPointers{}
+	parseField(r, reflect.ValueOf(data).Elem(), errors)
+	a.Empty(errors)
+	a.NotNil(data.Count).
+		Equal(*data.Count, 5)
+	a.NotNil(data.State).
+		Equal(*data.State, StateLocked)
+
+	expire, err := time.Parse(time.RFC3339, "2019-01-02T15:04:05Z")
+	a.NotError(err)
+	a.NotNil(data.Expire).
+		True(data.Expire.Equal(expire))
+
+	a.Equal(len(data.States), 2)
+	a.NotNil(data.States[0]).
+		Equal(*data.States[0], StateNormal)
+	a.NotNil(data.States[1]).
+		Equal(*data.States[1], StateLeft)
+
+	// 转换失败时，指针字段维持原状态
+	errors = map[string]string{}
+	r = httptest.NewRequest(http.MethodGet, "/q?count=abc", nil)
+	data = &testPointers{}
+	parseField(r, reflect.ValueOf(data).Elem(), errors)
+	a.True(errors["count"] != "")
+	a.Nil(data.Count)
+
+	// SanitizeQuery 可以通过 nil 判断字段是否被提供
+	r = httptest.NewRequest(http.MethodGet, "/q", nil)
+	data = &testPointers{}
+	errors = Parse(r, data)
+	a.True(errors["count"] != "")
+}
+
+// BenchmarkParse 验证 getTypeInfo 缓存在重复解析同一结构体类型时
+// 对性能和内存分配的影响。
+func BenchmarkParse(b *testing.B) {
+	r := httptest.NewRequest(http.MethodGet, "/q?string=str&strings=s1,s2&int=5&floats=1.1,2.2", nil)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		data := &testQueryObject{}
+		Parse(r, data)
+	}
+}